@@ -0,0 +1,71 @@
+package pack
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/pkg/errors"
+)
+
+// builderMetadataLabel is the image label Create writes BuilderMetadata to, and Refresh reads it
+// back from, on every builder image it produces.
+const builderMetadataLabel = "io.buildpacks.builder.metadata"
+
+// BuilderMetadata records what a builder image was built from, so Refresh can later tell whether
+// it needs to be rebuilt.
+type BuilderMetadata struct {
+	BaseImageRef    string `json:"baseImageRef"`
+	BaseImageDigest string `json:"baseImageDigest"`
+	// CreatedAt is the image's normalized Created time, per BuilderConfig.OutputTimestamp. It is not
+	// safe to use for age comparisons: under OutputTimestampZero or OutputTimestampSourceTimestamp it
+	// does not reflect when the build actually ran. Use BuiltAt for that.
+	CreatedAt time.Time `json:"createdAt"`
+	// BuiltAt is the actual wall-clock time Create ran, regardless of OutputTimestamp normalization.
+	// Refresh compares --max-age and buildpack source mtimes against this, not CreatedAt.
+	BuiltAt time.Time `json:"builtAt"`
+	// OutputTimestamp, Target, Flatten, and FlattenExclude record the CreateBuilderFlags this image
+	// was built with, so Refresh can rebuild it with the same shape instead of silently reverting to
+	// CreateBuilderFlags zero values on every scheduled refresh.
+	OutputTimestamp string   `json:"outputTimestamp"`
+	Target          string   `json:"target"`
+	Flatten         bool     `json:"flatten"`
+	FlattenExclude  []string `json:"flattenExclude"`
+}
+
+// setBuilderMetadataLabel writes metadata as the builderMetadataLabel on image.
+func setBuilderMetadataLabel(image v1.Image, metadata BuilderMetadata) (v1.Image, error) {
+	data, err := json.Marshal(metadata)
+	if err != nil {
+		return nil, errors.Wrap(err, "marshaling builder metadata")
+	}
+	configFile, err := image.ConfigFile()
+	if err != nil {
+		return nil, errors.Wrap(err, "reading image config file")
+	}
+	configFile = configFile.DeepCopy()
+	if configFile.Config.Labels == nil {
+		configFile.Config.Labels = map[string]string{}
+	}
+	configFile.Config.Labels[builderMetadataLabel] = string(data)
+	return mutate.ConfigFile(image, configFile)
+}
+
+// readBuilderMetadataLabel reads the BuilderMetadata previously written by setBuilderMetadataLabel.
+func readBuilderMetadataLabel(image v1.Image) (BuilderMetadata, error) {
+	configFile, err := image.ConfigFile()
+	if err != nil {
+		return BuilderMetadata{}, errors.Wrap(err, "reading image config file")
+	}
+	raw, ok := configFile.Config.Labels[builderMetadataLabel]
+	if !ok {
+		return BuilderMetadata{}, fmt.Errorf("image is missing the %s label; it was not created by this version of pack", builderMetadataLabel)
+	}
+	var metadata BuilderMetadata
+	if err := json.Unmarshal([]byte(raw), &metadata); err != nil {
+		return BuilderMetadata{}, errors.Wrap(err, "parsing builder metadata label")
+	}
+	return metadata, nil
+}
@@ -0,0 +1,323 @@
+package pack
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// BuildpackDownloader resolves a buildpack's URI (from a builder.toml [[buildpacks]] entry) to a
+// local directory containing its buildpack.toml, downloading or extracting it as needed. cleanup
+// removes any temporary files the downloader created and must be called once localDir is no longer
+// needed. When err is non-nil, cleanup is nil and the downloader has already removed anything it
+// created.
+//
+// sourceTimestamp is a stable timestamp describing the buildpack's content (e.g. a file's mtime, an
+// OCI image's Created time, or a git commit's author date) for use under OutputTimestampSourceTimestamp.
+// It is the zero time.Time when a downloader has no content-stable timestamp to offer (the scratch
+// directory it extracted into is not one, since its mtime is the moment of extraction); callers must
+// not stat localDir themselves as a substitute.
+//
+//go:generate mockgen -package mocks -destination mocks/buildpack_downloader.go github.com/buildpack/pack BuildpackDownloader
+type BuildpackDownloader interface {
+	Download(ctx context.Context, id, uri, builderDir string) (localDir string, sourceTimestamp time.Time, cleanup func(), err error)
+}
+
+// NewBuildpackDownloader returns a BuildpackDownloader that dispatches by URI scheme: file://
+// (and bare/relative paths) resolve to a local directory, http(s):// downloads a .tgz or .zip,
+// docker:// pulls an OCI image, and git+https:// (or git+http://) shallow-clones a repo.
+func NewBuildpackDownloader(docker Docker, images Images, fs FS) BuildpackDownloader {
+	return &dispatchingDownloader{
+		file:   &fileDownloader{},
+		http:   &httpDownloader{fs: fs},
+		docker: &dockerDownloader{docker: docker, images: images, fs: fs},
+		git:    &gitDownloader{},
+	}
+}
+
+type dispatchingDownloader struct {
+	file   BuildpackDownloader
+	http   BuildpackDownloader
+	docker BuildpackDownloader
+	git    BuildpackDownloader
+}
+
+func (d *dispatchingDownloader) Download(ctx context.Context, id, uri, builderDir string) (string, time.Time, func(), error) {
+	switch uriScheme(uri) {
+	case "http", "https":
+		return d.http.Download(ctx, id, uri, builderDir)
+	case "docker":
+		return d.docker.Download(ctx, id, uri, builderDir)
+	case "git+http", "git+https":
+		return d.git.Download(ctx, id, uri, builderDir)
+	default:
+		return d.file.Download(ctx, id, uri, builderDir)
+	}
+}
+
+// uriScheme returns the scheme portion of uri (everything before "://"), or "" if uri has none, as
+// is the case for the bare and relative paths buildpackLayer has always accepted.
+func uriScheme(uri string) string {
+	if i := strings.Index(uri, "://"); i >= 0 {
+		return uri[:i]
+	}
+	return ""
+}
+
+// fileDownloader resolves file:// and bare/relative buildpack paths, the original behavior of
+// buildpackLayer before downloaders were introduced.
+type fileDownloader struct{}
+
+func (d *fileDownloader) Download(ctx context.Context, id, uri, builderDir string) (string, time.Time, func(), error) {
+	dir := strings.TrimPrefix(uri, "file://")
+	if !filepath.IsAbs(dir) {
+		dir = filepath.Join(builderDir, dir)
+	}
+	ts, err := sourceTimestamp(dir)
+	if err != nil {
+		return "", time.Time{}, nil, err
+	}
+	return dir, ts, func() {}, nil
+}
+
+// httpDownloader downloads a .tgz or .zip buildpack archive over http(s). An optional
+// "#sha256:<digest>" fragment on the URI is verified against the downloaded bytes.
+type httpDownloader struct {
+	fs FS
+}
+
+func (d *httpDownloader) Download(ctx context.Context, id, uri, builderDir string) (string, time.Time, func(), error) {
+	downloadURI, checksum, err := splitChecksumFragment(uri)
+	if err != nil {
+		return "", time.Time{}, nil, err
+	}
+
+	req, err := http.NewRequest(http.MethodGet, downloadURI, nil)
+	if err != nil {
+		return "", time.Time{}, nil, errors.Wrapf(err, "building request for buildpack %s", downloadURI)
+	}
+	resp, err := http.DefaultClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return "", time.Time{}, nil, errors.Wrapf(err, "downloading buildpack %s", downloadURI)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", time.Time{}, nil, fmt.Errorf(`downloading buildpack "%s": unexpected status "%s"`, downloadURI, resp.Status)
+	}
+	// Last-Modified reflects the archive's own content, unlike the scratch dir it's extracted into
+	// below, so it's usable under OutputTimestampSourceTimestamp. Servers that omit it leave this zero.
+	var sourceTimestamp time.Time
+	if lastModified := resp.Header.Get("Last-Modified"); lastModified != "" {
+		if t, err := http.ParseTime(lastModified); err == nil {
+			sourceTimestamp = t
+		}
+	}
+
+	archive, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return "", time.Time{}, nil, errors.Wrapf(err, "reading buildpack %s", downloadURI)
+	}
+	if checksum != "" {
+		sum := sha256.Sum256(archive)
+		if actual := hex.EncodeToString(sum[:]); actual != checksum {
+			return "", time.Time{}, nil, fmt.Errorf(`checksum mismatch for buildpack "%s": expected sha256:%s, got sha256:%s`, downloadURI, checksum, actual)
+		}
+	}
+
+	destDir, err := ioutil.TempDir("", "buildpack-http")
+	if err != nil {
+		return "", time.Time{}, nil, errors.Wrap(err, "creating temp dir for downloaded buildpack")
+	}
+	cleanup := func() { os.RemoveAll(destDir) }
+
+	if strings.HasSuffix(downloadURI, ".zip") {
+		if err := unzip(archive, destDir); err != nil {
+			cleanup()
+			return "", time.Time{}, nil, errors.Wrapf(err, "unzipping buildpack %s", downloadURI)
+		}
+	} else {
+		if err := d.fs.Untar(bytes.NewReader(archive), destDir); err != nil {
+			cleanup()
+			return "", time.Time{}, nil, errors.Wrapf(err, "untarring buildpack %s", downloadURI)
+		}
+	}
+	return destDir, sourceTimestamp, cleanup, nil
+}
+
+// splitChecksumFragment splits an optional "#sha256:<digest>" fragment off uri, returning the
+// fragment-free download URL and the bare hex digest (empty if none was given).
+func splitChecksumFragment(uri string) (string, string, error) {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return "", "", errors.Wrapf(err, "parsing buildpack uri %s", uri)
+	}
+	checksum := strings.TrimPrefix(u.Fragment, "sha256:")
+	u.Fragment = ""
+	return u.String(), checksum, nil
+}
+
+func unzip(archive []byte, destDir string) error {
+	zr, err := zip.NewReader(bytes.NewReader(archive), int64(len(archive)))
+	if err != nil {
+		return err
+	}
+	for _, f := range zr.File {
+		path := filepath.Join(destDir, f.Name)
+		if !withinDir(destDir, path) {
+			return fmt.Errorf(`illegal file path "%s" in buildpack archive: escapes destination directory`, f.Name)
+		}
+		if f.FileInfo().IsDir() {
+			if err := os.MkdirAll(path, 0755); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return err
+		}
+		src, err := f.Open()
+		if err != nil {
+			return err
+		}
+		dst, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, f.Mode())
+		if err != nil {
+			src.Close()
+			return err
+		}
+		_, err = io.Copy(dst, src)
+		src.Close()
+		dst.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// withinDir reports whether path is dir itself or a descendant of it, guarding against a zip entry
+// name like "../../etc/passwd" (zip-slip) escaping destDir.
+func withinDir(dir, path string) bool {
+	dir = filepath.Clean(dir)
+	path = filepath.Clean(path)
+	return path == dir || strings.HasPrefix(path, dir+string(os.PathSeparator))
+}
+
+// dockerDownloader pulls an OCI image via Docker and extracts the buildpack matching id from its
+// /cnb/buildpacks/<id>/<version> tree. An image may carry more than one buildpack; only id is used.
+type dockerDownloader struct {
+	docker Docker
+	images Images
+	fs     FS
+}
+
+func (d *dockerDownloader) Download(ctx context.Context, id, uri, builderDir string) (string, time.Time, func(), error) {
+	ref := strings.TrimPrefix(uri, "docker://")
+	if err := d.docker.PullImage(ref); err != nil {
+		return "", time.Time{}, nil, errors.Wrapf(err, "pulling buildpack image %s", ref)
+	}
+	image, err := d.images.ReadImage(ref, true)
+	if err != nil {
+		return "", time.Time{}, nil, errors.Wrapf(err, "reading buildpack image %s", ref)
+	}
+	if image == nil {
+		return "", time.Time{}, nil, fmt.Errorf(`buildpack image "%s" was not found`, ref)
+	}
+	// The image's own Created time is tied to its digest, not to when it happened to be pulled here,
+	// so it's usable under OutputTimestampSourceTimestamp unlike the scratch dir extracted below.
+	var sourceTimestamp time.Time
+	if configFile, err := image.ConfigFile(); err == nil {
+		sourceTimestamp = configFile.Created.Time
+	}
+	layers, err := image.Layers()
+	if err != nil {
+		return "", time.Time{}, nil, errors.Wrapf(err, "reading layers of buildpack image %s", ref)
+	}
+
+	destDir, err := ioutil.TempDir("", "buildpack-docker")
+	if err != nil {
+		return "", time.Time{}, nil, errors.Wrap(err, "creating temp dir for buildpack image")
+	}
+	cleanup := func() { os.RemoveAll(destDir) }
+
+	for _, layer := range layers {
+		rc, err := layer.Uncompressed()
+		if err != nil {
+			cleanup()
+			return "", time.Time{}, nil, errors.Wrapf(err, "reading layer of buildpack image %s", ref)
+		}
+		err = d.fs.Untar(rc, destDir)
+		rc.Close()
+		if err != nil {
+			cleanup()
+			return "", time.Time{}, nil, errors.Wrapf(err, "extracting layer of buildpack image %s", ref)
+		}
+	}
+
+	idDir := filepath.Join(destDir, "cnb", "buildpacks", id)
+	versionDir, err := singleSubdir(idDir)
+	if err != nil {
+		cleanup()
+		return "", time.Time{}, nil, errors.Wrapf(err, "locating buildpack %s version in image %s", id, ref)
+	}
+	return versionDir, sourceTimestamp, cleanup, nil
+}
+
+// singleSubdir returns the one subdirectory of dir, or an error if dir has zero or more than one.
+func singleSubdir(dir string) (string, error) {
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return "", err
+	}
+	var dirs []os.FileInfo
+	for _, entry := range entries {
+		if entry.IsDir() {
+			dirs = append(dirs, entry)
+		}
+	}
+	if len(dirs) != 1 {
+		return "", fmt.Errorf("expected exactly one directory in %s, found %d", dir, len(dirs))
+	}
+	return filepath.Join(dir, dirs[0].Name()), nil
+}
+
+// gitDownloader shallow-clones a git+https:// or git+http:// buildpack repository.
+type gitDownloader struct{}
+
+func (d *gitDownloader) Download(ctx context.Context, id, uri, builderDir string) (string, time.Time, func(), error) {
+	repoURL := strings.TrimPrefix(uri, "git+")
+
+	destDir, err := ioutil.TempDir("", "buildpack-git")
+	if err != nil {
+		return "", time.Time{}, nil, errors.Wrap(err, "creating temp dir for git clone")
+	}
+	cleanup := func() { os.RemoveAll(destDir) }
+
+	cmd := exec.CommandContext(ctx, "git", "clone", "--depth", "1", repoURL, destDir)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		cleanup()
+		return "", time.Time{}, nil, errors.Wrapf(err, "cloning buildpack repo %s: %s", repoURL, string(out))
+	}
+	// The cloned commit's author date is tied to the commit, not to when it happened to be cloned
+	// here, so it's usable under OutputTimestampSourceTimestamp unlike destDir's own mtime.
+	var sourceTimestamp time.Time
+	if out, err := exec.CommandContext(ctx, "git", "-C", destDir, "log", "-1", "--format=%aI").Output(); err == nil {
+		if t, err := time.Parse(time.RFC3339, strings.TrimSpace(string(out))); err == nil {
+			sourceTimestamp = t
+		}
+	}
+	return destDir, sourceTimestamp, cleanup, nil
+}
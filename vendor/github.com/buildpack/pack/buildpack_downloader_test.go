@@ -0,0 +1,90 @@
+package pack
+
+import "testing"
+
+func TestWithinDir(t *testing.T) {
+	tests := []struct {
+		name string
+		dir  string
+		path string
+		want bool
+	}{
+		{name: "dir itself", dir: "/tmp/extract", path: "/tmp/extract", want: true},
+		{name: "direct child", dir: "/tmp/extract", path: "/tmp/extract/buildpack.toml", want: true},
+		{name: "nested child", dir: "/tmp/extract", path: "/tmp/extract/bin/detect", want: true},
+		{name: "zip-slip parent escape", dir: "/tmp/extract", path: "/tmp/etc/passwd", want: false},
+		{name: "zip-slip traversal escape", dir: "/tmp/extract", path: "/tmp/extract/../../etc/passwd", want: false},
+		{name: "sibling directory with shared prefix", dir: "/tmp/extract", path: "/tmp/extract-evil/passwd", want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := withinDir(tt.dir, tt.path); got != tt.want {
+				t.Errorf("withinDir(%q, %q) = %v, want %v", tt.dir, tt.path, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSplitChecksumFragment(t *testing.T) {
+	tests := []struct {
+		name         string
+		uri          string
+		wantURI      string
+		wantChecksum string
+		wantErr      bool
+	}{
+		{
+			name:         "no fragment",
+			uri:          "https://example.com/buildpack.tgz",
+			wantURI:      "https://example.com/buildpack.tgz",
+			wantChecksum: "",
+		},
+		{
+			name:         "sha256 fragment",
+			uri:          "https://example.com/buildpack.tgz#sha256:abc123",
+			wantURI:      "https://example.com/buildpack.tgz",
+			wantChecksum: "abc123",
+		},
+		{
+			name:    "invalid uri",
+			uri:     "://not-a-uri",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotURI, gotChecksum, err := splitChecksumFragment(tt.uri)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("splitChecksumFragment(%q) expected an error, got none", tt.uri)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("splitChecksumFragment(%q) returned unexpected error: %s", tt.uri, err)
+			}
+			if gotURI != tt.wantURI || gotChecksum != tt.wantChecksum {
+				t.Errorf("splitChecksumFragment(%q) = (%q, %q), want (%q, %q)", tt.uri, gotURI, gotChecksum, tt.wantURI, tt.wantChecksum)
+			}
+		})
+	}
+}
+
+func TestUriScheme(t *testing.T) {
+	tests := []struct {
+		uri  string
+		want string
+	}{
+		{uri: "file:///path/to/buildpack", want: "file"},
+		{uri: "https://example.com/buildpack.tgz", want: "https"},
+		{uri: "docker://example.com/buildpack:latest", want: "docker"},
+		{uri: "git+https://example.com/buildpack.git", want: "git+https"},
+		{uri: "../relative/buildpack", want: ""},
+		{uri: "buildpack", want: ""},
+	}
+	for _, tt := range tests {
+		if got := uriScheme(tt.uri); got != tt.want {
+			t.Errorf("uriScheme(%q) = %q, want %q", tt.uri, got, tt.want)
+		}
+	}
+}
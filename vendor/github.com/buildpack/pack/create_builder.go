@@ -8,7 +8,8 @@ import (
 	"log"
 	"os"
 	"path/filepath"
-	"strings"
+	"sync"
+	"time"
 
 	"github.com/BurntSushi/toml"
 	"github.com/buildpack/lifecycle"
@@ -18,16 +19,62 @@ import (
 	"github.com/docker/docker/api/types/container"
 	"github.com/docker/docker/api/types/network"
 	"github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
 	"github.com/pkg/errors"
 )
 
+// Accepted values for CreateBuilderFlags.OutputTimestamp and BuilderConfig.OutputTimestamp.
+const (
+	// OutputTimestampZero sets every tar entry, and the resulting image's created time, to the UNIX epoch.
+	OutputTimestampZero = "Zero"
+	// OutputTimestampSourceTimestamp stamps each buildpack layer with the source timestamp its
+	// BuildpackDownloader reports (for a local buildpack, the mtime of its directory), falling back to
+	// the build time when there is none; the order.toml layer and the image use the builder.toml
+	// directory's mtime.
+	OutputTimestampSourceTimestamp = "SourceTimestamp"
+	// OutputTimestampBuildTimestamp uses the current build time. This is the default, preserving prior behavior.
+	OutputTimestampBuildTimestamp = "BuildTimestamp"
+)
+
+// ErrOutputTimestampValueNotSupported is returned when OutputTimestamp is set to a value other than
+// "Zero", "SourceTimestamp", or "BuildTimestamp".
+var ErrOutputTimestampValueNotSupported = errors.New(`output timestamp value not supported, must be one of "Zero", "SourceTimestamp", or "BuildTimestamp"`)
+
 type BuilderConfig struct {
-	RepoName   string
-	Repo       img.Store
-	Buildpacks []Buildpack                `toml:"buildpacks"`
-	Groups     []lifecycle.BuildpackGroup `toml:"groups"`
-	BaseImage  v1.Image
-	BuilderDir string //original location of builder.toml, used for interpreting relative paths in buildpack URIs
+	RepoName     string
+	Repo         img.Store
+	Buildpacks   []Buildpack                `toml:"buildpacks"`
+	Groups       []lifecycle.BuildpackGroup `toml:"groups"`
+	BaseImage    v1.Image
+	BaseImageRef string //reference BaseImage was read from, recorded in the builder metadata label so Refresh can detect when it moves
+	BuilderDir   string //original location of builder.toml, used for interpreting relative paths in buildpack URIs
+	// OutputTimestamp controls the mtime written for every layer entry and the image's created time.
+	// One of OutputTimestampZero, OutputTimestampSourceTimestamp, or OutputTimestampBuildTimestamp (default).
+	OutputTimestamp string
+	// TargetOS/TargetArch/TargetArchVariant/TargetDistroName/TargetDistroVersion select which of a
+	// multi-target builder.toml's buildpacks and stack build images apply. Populated from
+	// CreateBuilderFlags.Target. Empty selects every buildpack, preserving single-target behavior.
+	TargetOS            string
+	TargetArch          string
+	TargetArchVariant   string
+	TargetDistroName    string
+	TargetDistroVersion string
+	// Flatten merges the order.toml and every non-excluded buildpack into a single image layer
+	// instead of one layer per buildpack, reducing layer count at the cost of cache granularity.
+	Flatten bool
+	// FlattenExclude lists buildpack IDs to keep as their own layer even when Flatten is set, e.g.
+	// buildpacks that change often and would otherwise bust the cache for the whole flattened layer.
+	FlattenExclude []string
+}
+
+// target reconstructs the Target selector encoded by this config's TargetOS/TargetArch fields, for
+// matching against a buildpack's declared [[targets]].
+func (c BuilderConfig) target() Target {
+	target := Target{OS: c.TargetOS, Arch: c.TargetArch, ArchVariant: c.TargetArchVariant}
+	if c.TargetDistroName != "" {
+		target.Distributions = []Distribution{{Name: c.TargetDistroName, Version: c.TargetDistroVersion}}
+	}
+	return target
 }
 
 type Buildpack struct {
@@ -55,17 +102,29 @@ type Images interface {
 }
 
 type BuilderFactory struct {
-	Log    *log.Logger
-	Docker Docker
-	FS     FS
-	Config *config.Config
-	Images Images
+	Log        *log.Logger
+	Docker     Docker
+	FS         FS
+	Config     *config.Config
+	Images     Images
+	Downloader BuildpackDownloader
+}
+
+// downloader returns the configured Downloader, or a default one supporting file://, http(s)://,
+// docker://, and git+https:// buildpack URIs when none was injected.
+func (f *BuilderFactory) downloader() BuildpackDownloader {
+	if f.Downloader != nil {
+		return f.Downloader
+	}
+	return NewBuildpackDownloader(f.Docker, f.Images, f.FS)
 }
 
 //go:generate mockgen -package mocks -destination mocks/fs.go github.com/buildpack/pack FS
 type FS interface {
-	CreateTGZFile(tarFile, srcDir, tarDir string, uid, gid int) error
+	CreateTGZFile(tarFile, srcDir, tarDir string, uid, gid int, timestamp time.Time) error
 	CreateTarReader(srcDir, tarDir string, uid, gid int) (io.Reader, chan error)
+	// Untar extracts r into dest. Implementations must reject any entry whose cleaned path escapes
+	// dest (zip-slip); httpDownloader and dockerDownloader feed this untrusted buildpack archives.
 	Untar(r io.Reader, dest string) error
 	CreateSingleFileTar(path, txt string) (io.Reader, error)
 }
@@ -76,10 +135,27 @@ type CreateBuilderFlags struct {
 	StackID         string
 	Publish         bool
 	NoPull          bool
+	// OutputTimestamp controls the mtime written for every layer entry and the image's created time.
+	// One of OutputTimestampZero, OutputTimestampSourceTimestamp, or OutputTimestampBuildTimestamp (default).
+	OutputTimestamp string
+	// Target selects a single os/arch[/arch-variant][:distro-name@distro-version] to build for, e.g.
+	// "linux/arm/v6:ubuntu@20.04". Empty builds for every target declared in builder.toml, the
+	// previous single-target behavior.
+	Target string
+	// Flatten merges the order.toml and every non-excluded buildpack into a single image layer
+	// instead of one layer per buildpack, reducing layer count at the cost of cache granularity.
+	Flatten bool
+	// FlattenExclude lists buildpack IDs to keep as their own layer even when Flatten is set, e.g.
+	// buildpacks that change often and would otherwise bust the cache for the whole flattened layer.
+	FlattenExclude []string
 }
 
 func (f *BuilderFactory) BuilderConfigFromFlags(flags CreateBuilderFlags) (BuilderConfig, error) {
-	baseImage, err := f.baseImageName(flags.StackID, flags.RepoName)
+	target, err := parseTargetFlag(flags.Target)
+	if err != nil {
+		return BuilderConfig{}, err
+	}
+	baseImage, err := f.baseImageName(flags.StackID, flags.RepoName, target, !flags.Publish)
 	if err != nil {
 		return BuilderConfig{}, err
 	}
@@ -90,12 +166,22 @@ func (f *BuilderFactory) BuilderConfigFromFlags(flags CreateBuilderFlags) (Build
 			return BuilderConfig{}, fmt.Errorf(`failed to pull stack build image "%s": %s`, baseImage, err)
 		}
 	}
-	builderConfig := BuilderConfig{RepoName: flags.RepoName}
+	builderConfig := BuilderConfig{RepoName: flags.RepoName, OutputTimestamp: flags.OutputTimestamp}
+	if len(target.Distributions) > 0 {
+		builderConfig.TargetDistroName = target.Distributions[0].Name
+		builderConfig.TargetDistroVersion = target.Distributions[0].Version
+	}
+	builderConfig.TargetOS = target.OS
+	builderConfig.TargetArch = target.Arch
+	builderConfig.TargetArchVariant = target.ArchVariant
+	builderConfig.Flatten = flags.Flatten
+	builderConfig.FlattenExclude = flags.FlattenExclude
 	_, err = toml.DecodeFile(flags.BuilderTomlPath, &builderConfig)
 	if err != nil {
 		return BuilderConfig{}, fmt.Errorf(`failed to decode builder config from file "%s": %s`, flags.BuilderTomlPath, err)
 	}
 	builderConfig.BuilderDir = filepath.Dir(flags.BuilderTomlPath)
+	builderConfig.BaseImageRef = baseImage
 	builderConfig.BaseImage, err = f.Images.ReadImage(baseImage, !flags.Publish)
 	if err != nil {
 		return BuilderConfig{}, fmt.Errorf(`failed to read base image "%s": %s`, baseImage, err)
@@ -110,7 +196,7 @@ func (f *BuilderFactory) BuilderConfigFromFlags(flags CreateBuilderFlags) (Build
 	return builderConfig, nil
 }
 
-func (f *BuilderFactory) baseImageName(stackID, repoName string) (string, error) {
+func (f *BuilderFactory) baseImageName(stackID, repoName string, target Target, useDaemon bool) (string, error) {
 	stack, err := f.Config.Get(stackID)
 	if err != nil {
 		return "", err
@@ -118,6 +204,9 @@ func (f *BuilderFactory) baseImageName(stackID, repoName string) (string, error)
 	if len(stack.BuildImages) == 0 {
 		return "", fmt.Errorf(`Invalid stack: stack "%s" requies at least one build image`, stack.ID)
 	}
+	if target.OS != "" || target.Arch != "" {
+		return f.imageByTarget(target.OS, target.Arch, stack.BuildImages, useDaemon)
+	}
 	registry, err := config.Registry(repoName)
 	if err != nil {
 		return "", err
@@ -125,31 +214,138 @@ func (f *BuilderFactory) baseImageName(stackID, repoName string) (string, error)
 	return config.ImageByRegistry(registry, stack.BuildImages)
 }
 
+// imageByTarget returns the first of images whose config file declares the given os and arch, for
+// selecting a stack's build image when a builder.toml declares multiple targets via --target (see
+// BuilderConfig.TargetOS/TargetArch). Unlike config.ImageByRegistry, which disambiguates identical
+// content mirrored across registries, this disambiguates genuinely different build images published
+// for different platforms under the same stack. Images are read through f.Images, like every other
+// image read in this package, so it honors useDaemon and registry auth instead of always reaching
+// out to the remote registry anonymously.
+func (f *BuilderFactory) imageByTarget(os, arch string, images []string, useDaemon bool) (string, error) {
+	for _, ref := range images {
+		image, err := f.Images.ReadImage(ref, useDaemon)
+		if err != nil {
+			return "", fmt.Errorf(`failed to read build image "%s": %s`, ref, err)
+		}
+		if image == nil {
+			continue
+		}
+		configFile, err := image.ConfigFile()
+		if err != nil {
+			return "", fmt.Errorf(`failed to read config for build image "%s": %s`, ref, err)
+		}
+		if configFile.OS == os && configFile.Architecture == arch {
+			return ref, nil
+		}
+	}
+	return "", fmt.Errorf(`no build image found for target "%s/%s"`, os, arch)
+}
+
 func (f *BuilderFactory) Create(config BuilderConfig) error {
 	tmpDir, err := ioutil.TempDir("", "create-builder")
 	if err != nil {
 		return fmt.Errorf(`failed to create temporary directory: %s`, err)
 	}
-	defer os.Remove(tmpDir)
+	defer func() {
+		if err := os.RemoveAll(tmpDir); err != nil {
+			f.Log.Printf("failed to remove temporary directory %q: %s\n", tmpDir, err)
+		}
+	}()
 
-	orderTar, err := f.orderLayer(tmpDir, config.Groups)
+	builderTime, err := resolveOutputTimestamp(config.OutputTimestamp, config.BuilderDir)
 	if err != nil {
-		return fmt.Errorf(`failed generate order.toml layer: %s`, err)
+		return fmt.Errorf(`failed to resolve output timestamp "%s": %s`, config.OutputTimestamp, err)
 	}
-	builderImage, _, err := img.Append(config.BaseImage, orderTar)
+
+	sources, cleanup, err := f.downloadBuildpacks(context.Background(), config.Buildpacks, config.BuilderDir)
+	defer cleanup()
 	if err != nil {
-		return fmt.Errorf(`failed append order.toml layer to image: %s`, err)
+		return err
+	}
+
+	target := config.target()
+	var resolved []resolvedBuildpack
+	skipped := map[string]bool{}
+	for _, source := range sources {
+		descriptor, err := readBuildpackDescriptor(source.buildpack, source.localDir)
+		if err != nil {
+			return fmt.Errorf(`failed to read buildpack descriptor for "%s": %s`, source.buildpack.ID, err)
+		}
+		if !targetMatches(target, descriptor.Targets) {
+			f.Log.Printf("Skipping buildpack %q: does not support target %s/%s\n", source.buildpack.ID, config.TargetOS, config.TargetArch)
+			skipped[source.buildpack.ID] = true
+			continue
+		}
+
+		layerDir := source.localDir
+		if len(descriptor.Targets) > 0 {
+			layerDir, err = stageBuildpackWithTargets(tmpDir, source.buildpack, source.localDir, descriptor.Targets)
+			if err != nil {
+				return err
+			}
+		}
+		layerTime := builderTime
+		if config.OutputTimestamp == OutputTimestampSourceTimestamp {
+			if !source.sourceTimestamp.IsZero() {
+				layerTime = source.sourceTimestamp
+			} else {
+				f.Log.Printf("buildpack %q has no reliable source timestamp; using build timestamp instead\n", source.buildpack.ID)
+			}
+		}
+		resolved = append(resolved, resolvedBuildpack{descriptor: descriptor, dir: layerDir, timestamp: layerTime})
 	}
-	for _, buildpack := range config.Buildpacks {
-		tarFile, err := f.buildpackLayer(tmpDir, buildpack, config.BuilderDir)
+
+	groups := f.filterGroups(config.Groups, skipped)
+
+	var builderImage v1.Image
+	var layerTimestamps []time.Time
+	if config.Flatten {
+		builderImage, layerTimestamps, err = f.appendFlattenedLayer(config.BaseImage, tmpDir, groups, resolved, config.FlattenExclude, builderTime)
+		if err != nil {
+			return err
+		}
+	} else {
+		orderTar, err := f.orderLayer(tmpDir, groups, builderTime)
 		if err != nil {
-			return fmt.Errorf(`failed generate layer for buildpack "%s": %s`, buildpack.ID, err)
+			return fmt.Errorf(`failed generate order.toml layer: %s`, err)
 		}
-		builderImage, _, err = img.Append(builderImage, tarFile)
+		builderImage, _, err = img.Append(config.BaseImage, orderTar)
 		if err != nil {
-			return fmt.Errorf(`failed append buildpack layer to image: %s`, err)
+			return fmt.Errorf(`failed append order.toml layer to image: %s`, err)
 		}
+		layerTimestamps = append(layerTimestamps, builderTime)
+
+		var buildpackTimestamps []time.Time
+		builderImage, buildpackTimestamps, err = f.appendLayeredBuildpacks(builderImage, tmpDir, resolved)
+		if err != nil {
+			return err
+		}
+		layerTimestamps = append(layerTimestamps, buildpackTimestamps...)
+	}
+
+	builderImage, err = setImageTimestamps(builderImage, builderTime, layerTimestamps)
+	if err != nil {
+		return fmt.Errorf(`failed to normalize image timestamps: %s`, err)
+	}
+
+	baseImageDigest, err := config.BaseImage.Digest()
+	if err != nil {
+		return fmt.Errorf(`failed to read base image digest: %s`, err)
+	}
+	builderImage, err = setBuilderMetadataLabel(builderImage, BuilderMetadata{
+		BaseImageRef:    config.BaseImageRef,
+		BaseImageDigest: baseImageDigest.String(),
+		CreatedAt:       builderTime,
+		BuiltAt:         time.Now().UTC(),
+		OutputTimestamp: config.OutputTimestamp,
+		Target:          formatTargetFlag(target),
+		Flatten:         config.Flatten,
+		FlattenExclude:  config.FlattenExclude,
+	})
+	if err != nil {
+		return fmt.Errorf(`failed to write builder metadata label: %s`, err)
 	}
+
 	if err := config.Repo.Write(builderImage); err != nil {
 		return err
 	}
@@ -161,58 +357,161 @@ func (f *BuilderFactory) Create(config BuilderConfig) error {
 	return nil
 }
 
+// buildpackSource is a buildpack resolved to a local directory by a BuildpackDownloader.
+type buildpackSource struct {
+	buildpack Buildpack
+	localDir  string
+	// sourceTimestamp is the buildpack's content timestamp, per BuildpackDownloader.Download. It is
+	// the zero time.Time when the downloader has no content-stable timestamp to offer.
+	sourceTimestamp time.Time
+}
+
+// downloadBuildpacks resolves every buildpack's URI to a local directory concurrently through the
+// configured downloader. The returned cleanup func must always be called, even on error, to remove
+// any temporary files the downloads produced.
+func (f *BuilderFactory) downloadBuildpacks(ctx context.Context, buildpacks []Buildpack, builderDir string) ([]buildpackSource, func(), error) {
+	downloader := f.downloader()
+	sources := make([]buildpackSource, len(buildpacks))
+	cleanups := make([]func(), len(buildpacks))
+	errs := make([]error, len(buildpacks))
+
+	var wg sync.WaitGroup
+	for i, buildpack := range buildpacks {
+		wg.Add(1)
+		go func(i int, buildpack Buildpack) {
+			defer wg.Done()
+			localDir, sourceTimestamp, cleanup, err := downloader.Download(ctx, buildpack.ID, buildpack.URI, builderDir)
+			sources[i] = buildpackSource{buildpack: buildpack, localDir: localDir, sourceTimestamp: sourceTimestamp}
+			cleanups[i] = cleanup
+			errs[i] = err
+		}(i, buildpack)
+	}
+	wg.Wait()
+
+	cleanup := func() {
+		for _, c := range cleanups {
+			if c != nil {
+				c()
+			}
+		}
+	}
+	for i, err := range errs {
+		if err != nil {
+			return nil, cleanup, fmt.Errorf(`failed to resolve buildpack "%s": %s`, buildpacks[i].ID, err)
+		}
+	}
+	return sources, cleanup, nil
+}
+
 type order struct {
 	Groups []lifecycle.BuildpackGroup `toml:"groups"`
 }
 
-func (f *BuilderFactory) orderLayer(dest string, groups []lifecycle.BuildpackGroup) (layerTar string, err error) {
-	buildpackDir := filepath.Join(dest, "buildpack")
-	err = os.Mkdir(buildpackDir, 0755)
-	if err != nil {
-		return "", err
+// filterGroups drops every buildpack named in skipped from groups, and the group itself if doing so
+// leaves it empty, so order.toml never references a buildpack whose target was skipped and for
+// which no /buildpacks/<id>/<version> layer exists.
+func (f *BuilderFactory) filterGroups(groups []lifecycle.BuildpackGroup, skipped map[string]bool) []lifecycle.BuildpackGroup {
+	if len(skipped) == 0 {
+		return groups
 	}
-
-	orderFile, err := os.Create(filepath.Join(buildpackDir, "order.toml"))
-	if err != nil {
-		return "", err
+	var filtered []lifecycle.BuildpackGroup
+	for _, group := range groups {
+		var buildpacks []lifecycle.Buildpack
+		for _, bp := range group.Buildpacks {
+			if skipped[bp.ID] {
+				continue
+			}
+			buildpacks = append(buildpacks, bp)
+		}
+		if len(buildpacks) == 0 {
+			f.Log.Printf("Skipping group: every buildpack in it was skipped for the requested target\n")
+			continue
+		}
+		group.Buildpacks = buildpacks
+		filtered = append(filtered, group)
 	}
-	defer orderFile.Close()
-	err = toml.NewEncoder(orderFile).Encode(order{Groups: groups})
-	if err != nil {
+	return filtered
+}
+
+func (f *BuilderFactory) orderLayer(dest string, groups []lifecycle.BuildpackGroup, timestamp time.Time) (layerTar string, err error) {
+	buildpackDir := filepath.Join(dest, "buildpack")
+	if err := writeOrderToml(buildpackDir, groups); err != nil {
 		return "", err
 	}
 	layerTar = filepath.Join(dest, "order.tar")
-	if err := f.FS.CreateTGZFile(layerTar, buildpackDir, "/buildpacks", 0, 0); err != nil {
+	if err := f.FS.CreateTGZFile(layerTar, buildpackDir, "/buildpacks", 0, 0, timestamp); err != nil {
 		return "", err
 	}
 	return layerTar, nil
 }
 
-func (f *BuilderFactory) buildpackLayer(dest string, buildpack Buildpack, builderDir string) (layerTar string, err error) {
-	dir := strings.TrimPrefix(buildpack.URI, "file://")
-	if !filepath.IsAbs(dir) {
-		dir = filepath.Join(builderDir, dir)
+// writeOrderToml writes order.toml describing groups into dir, creating dir if necessary.
+func writeOrderToml(dir string, groups []lifecycle.BuildpackGroup) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	orderFile, err := os.Create(filepath.Join(dir, "order.toml"))
+	if err != nil {
+		return err
+	}
+	defer orderFile.Close()
+	return toml.NewEncoder(orderFile).Encode(order{Groups: groups})
+}
+
+// resolveOutputTimestamp resolves an OutputTimestamp value to the time that should be stamped on
+// image layers and the image itself. builderDir is used to resolve OutputTimestampSourceTimestamp
+// for the order.toml layer, which is not tied to a single buildpack.
+func resolveOutputTimestamp(value, builderDir string) (time.Time, error) {
+	switch value {
+	case "", OutputTimestampBuildTimestamp:
+		return time.Now().UTC(), nil
+	case OutputTimestampZero:
+		return time.Unix(0, 0).UTC(), nil
+	case OutputTimestampSourceTimestamp:
+		return sourceTimestamp(builderDir)
+	default:
+		return time.Time{}, ErrOutputTimestampValueNotSupported
 	}
-	var data struct {
-		BP struct {
-			ID      string `toml:"id"`
-			Version string `toml:"version"`
-		} `toml:"buildpack"`
+}
+
+// sourceTimestamp returns the mtime of path, used to resolve OutputTimestampSourceTimestamp.
+func sourceTimestamp(path string) (time.Time, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return time.Time{}, errors.Wrapf(err, "resolving source timestamp for %s", path)
 	}
-	_, err = toml.DecodeFile(filepath.Join(dir, "buildpack.toml"), &data)
+	return info.ModTime().UTC(), nil
+}
+
+// setImageTimestamps rewrites image's created time to builderTime, and the history entry of each
+// layer Create appended to its corresponding entry in layerTimestamps (in append order), so the
+// resulting image is reproducible regardless of when it was built. Under OutputTimestampSourceTimestamp
+// layerTimestamps carries one value per buildpack's own source mtime rather than a single uniform
+// value, so history stays as granular as the layer tars themselves. History entries predating
+// Create's appends (i.e. the base image's own layers) are left untouched.
+func setImageTimestamps(image v1.Image, builderTime time.Time, layerTimestamps []time.Time) (v1.Image, error) {
+	configFile, err := image.ConfigFile()
 	if err != nil {
-		return "", errors.Wrapf(err, "reading buildpack.toml from buildpack: %s", filepath.Join(dir, "buildpack.toml"))
+		return nil, errors.Wrap(err, "reading image config file")
 	}
-	bp := data.BP
-	if buildpack.ID != bp.ID {
-		return "", fmt.Errorf("buildpack ids did not match: %s != %s", buildpack.ID, bp.ID)
+	configFile = configFile.DeepCopy()
+	configFile.Created = v1.Time{Time: builderTime}
+	start := len(configFile.History) - len(layerTimestamps)
+	if start < 0 {
+		return nil, fmt.Errorf("image has fewer history entries (%d) than layers Create appended (%d)", len(configFile.History), len(layerTimestamps))
 	}
-	if bp.Version == "" {
-		return "", fmt.Errorf("buildpack.toml must provide version: %s", filepath.Join(dir, "buildpack.toml"))
+	for i, timestamp := range layerTimestamps {
+		configFile.History[start+i].Created = v1.Time{Time: timestamp}
 	}
-	tarFile := filepath.Join(dest, fmt.Sprintf("%s.%s.tar", buildpack.ID, bp.Version))
-	if err := f.FS.CreateTGZFile(tarFile, dir, filepath.Join("/buildpacks", buildpack.ID, bp.Version), 0, 0); err != nil {
+	return mutate.ConfigFile(image, configFile)
+}
+
+// buildpackLayer tars the already-resolved dir (a buildpack's source, or its staged copy carrying
+// targets.toml) into a single layer named for the buildpack's id and version.
+func (f *BuilderFactory) buildpackLayer(dest string, descriptor buildpackDescriptor, dir string, timestamp time.Time) (layerTar string, err error) {
+	tarFile := filepath.Join(dest, fmt.Sprintf("%s.%s.tar", descriptor.ID, descriptor.Version))
+	if err := f.FS.CreateTGZFile(tarFile, dir, filepath.Join("/buildpacks", descriptor.ID, descriptor.Version), 0, 0, timestamp); err != nil {
 		return "", err
 	}
-	return tarFile, err
+	return tarFile, nil
 }
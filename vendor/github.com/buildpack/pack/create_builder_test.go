@@ -0,0 +1,124 @@
+package pack
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/buildpack/lifecycle/img"
+	"github.com/google/go-containerregistry/pkg/v1"
+)
+
+// fakeImages is a minimal Images fake for tests that need to control what ReadImage returns without
+// touching a real registry or daemon. It also records the useDaemon argument each call was made
+// with, so tests can assert it was threaded through rather than hardcoded.
+type fakeImages struct {
+	images       map[string]v1.Image
+	useDaemonLog []bool
+}
+
+func (f *fakeImages) ReadImage(repoName string, useDaemon bool) (v1.Image, error) {
+	f.useDaemonLog = append(f.useDaemonLog, useDaemon)
+	return f.images[repoName], nil
+}
+
+func (f *fakeImages) RepoStore(repoName string, useDaemon bool) (img.Store, error) {
+	return nil, nil
+}
+
+// fakeImage is a minimal v1.Image fake exposing only the OS/Architecture imageByTarget reads.
+type fakeImage struct {
+	os, arch string
+}
+
+func (i *fakeImage) Layers() ([]v1.Layer, error)              { return nil, nil }
+func (i *fakeImage) MediaType() (v1.MediaType, error)         { return "", nil }
+func (i *fakeImage) Size() (int64, error)                     { return 0, nil }
+func (i *fakeImage) ConfigName() (v1.Hash, error)             { return v1.Hash{}, nil }
+func (i *fakeImage) RawConfigFile() ([]byte, error)           { return nil, nil }
+func (i *fakeImage) Digest() (v1.Hash, error)                 { return v1.Hash{}, nil }
+func (i *fakeImage) Manifest() (*v1.Manifest, error)          { return nil, nil }
+func (i *fakeImage) RawManifest() ([]byte, error)             { return nil, nil }
+func (i *fakeImage) LayerByDigest(v1.Hash) (v1.Layer, error)  { return nil, nil }
+func (i *fakeImage) LayerByDiffID(v1.Hash) (v1.Layer, error)  { return nil, nil }
+
+func (i *fakeImage) ConfigFile() (*v1.ConfigFile, error) {
+	return &v1.ConfigFile{OS: i.os, Architecture: i.arch}, nil
+}
+
+func TestImageByTarget(t *testing.T) {
+	tests := []struct {
+		name      string
+		images    map[string]v1.Image
+		refs      []string
+		os, arch  string
+		useDaemon bool
+		want      string
+		wantErr   bool
+	}{
+		{
+			name: "returns the matching image",
+			images: map[string]v1.Image{
+				"example.com/build:amd64": &fakeImage{os: "linux", arch: "amd64"},
+				"example.com/build:arm64": &fakeImage{os: "linux", arch: "arm64"},
+			},
+			refs:      []string{"example.com/build:amd64", "example.com/build:arm64"},
+			os:        "linux",
+			arch:      "arm64",
+			useDaemon: true,
+			want:      "example.com/build:arm64",
+		},
+		{
+			name: "skips a reference Images has no image for",
+			images: map[string]v1.Image{
+				"example.com/build:arm64": &fakeImage{os: "linux", arch: "arm64"},
+			},
+			refs: []string{"example.com/build:amd64", "example.com/build:arm64"},
+			os:   "linux",
+			arch: "arm64",
+			want: "example.com/build:arm64",
+		},
+		{
+			name: "no image matches the requested target",
+			images: map[string]v1.Image{
+				"example.com/build:amd64": &fakeImage{os: "linux", arch: "amd64"},
+			},
+			refs:    []string{"example.com/build:amd64"},
+			os:      "linux",
+			arch:    "arm64",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			images := &fakeImages{images: tt.images}
+			f := &BuilderFactory{Images: images}
+			got, err := f.imageByTarget(tt.os, tt.arch, tt.refs, tt.useDaemon)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("imageByTarget(%q, %q, %v) expected an error, got none", tt.os, tt.arch, tt.refs)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("imageByTarget(%q, %q, %v) returned unexpected error: %s", tt.os, tt.arch, tt.refs, err)
+			}
+			if got != tt.want {
+				t.Errorf("imageByTarget(%q, %q, %v) = %q, want %q", tt.os, tt.arch, tt.refs, got, tt.want)
+			}
+			for _, used := range images.useDaemonLog {
+				if used != tt.useDaemon {
+					t.Errorf("imageByTarget read an image with useDaemon=%v, want %v", used, tt.useDaemon)
+				}
+			}
+		})
+	}
+}
+
+func TestImageByTargetErrorIncludesTarget(t *testing.T) {
+	f := &BuilderFactory{Images: &fakeImages{}}
+	_, err := f.imageByTarget("linux", "arm64", []string{"example.com/build"}, true)
+	if err == nil || !strings.Contains(fmt.Sprint(err), "linux/arm64") {
+		t.Fatalf("expected an error naming the unmatched target, got %v", err)
+	}
+}
@@ -0,0 +1,90 @@
+package pack
+
+import (
+	"fmt"
+	"path/filepath"
+	"time"
+
+	"github.com/buildpack/lifecycle"
+	"github.com/buildpack/lifecycle/img"
+	"github.com/google/go-containerregistry/pkg/v1"
+)
+
+// resolvedBuildpack is a buildpack that passed target matching, with its final (possibly staged
+// with targets.toml) layer directory and the timestamp its layer should carry.
+type resolvedBuildpack struct {
+	descriptor buildpackDescriptor
+	dir        string
+	timestamp  time.Time
+}
+
+// appendLayeredBuildpacks appends one image layer per resolved buildpack, the default (non-flatten)
+// behavior. It returns each appended layer's timestamp, in append order, so the caller can stamp
+// the image's history to match.
+func (f *BuilderFactory) appendLayeredBuildpacks(builderImage v1.Image, dest string, resolved []resolvedBuildpack) (v1.Image, []time.Time, error) {
+	timestamps := make([]time.Time, 0, len(resolved))
+	for _, bp := range resolved {
+		tarFile, err := f.buildpackLayer(dest, bp.descriptor, bp.dir, bp.timestamp)
+		if err != nil {
+			return nil, nil, fmt.Errorf(`failed generate layer for buildpack "%s": %s`, bp.descriptor.ID, err)
+		}
+		appended, _, err := img.Append(builderImage, tarFile)
+		if err != nil {
+			return nil, nil, fmt.Errorf(`failed append buildpack layer to image: %s`, err)
+		}
+		builderImage = appended
+		timestamps = append(timestamps, bp.timestamp)
+	}
+	return builderImage, timestamps, nil
+}
+
+// appendFlattenedLayer merges order.toml and every buildpack not named in exclude into a single
+// layer, then appends any excluded buildpacks as their own layers so they keep independent caching.
+// It returns the timestamp of every layer appended (the flattened layer, then one per excluded
+// buildpack), in append order, so the caller can stamp the image's history to match.
+func (f *BuilderFactory) appendFlattenedLayer(builderImage v1.Image, dest string, groups []lifecycle.BuildpackGroup, resolved []resolvedBuildpack, exclude []string, timestamp time.Time) (v1.Image, []time.Time, error) {
+	included, excluded := partitionFlatten(resolved, exclude)
+
+	mergeDir := filepath.Join(dest, "flatten")
+	if err := writeOrderToml(mergeDir, groups); err != nil {
+		return nil, nil, fmt.Errorf(`failed to generate order.toml for flattened layer: %s`, err)
+	}
+	for _, bp := range included {
+		bpDir := filepath.Join(mergeDir, bp.descriptor.ID, bp.descriptor.Version)
+		if err := copyDir(bp.dir, bpDir); err != nil {
+			return nil, nil, fmt.Errorf(`failed to merge buildpack "%s" into flattened layer: %s`, bp.descriptor.ID, err)
+		}
+	}
+
+	flattenTar := filepath.Join(dest, "flatten.tar")
+	if err := f.FS.CreateTGZFile(flattenTar, mergeDir, "/buildpacks", 0, 0, timestamp); err != nil {
+		return nil, nil, fmt.Errorf(`failed to create flattened layer: %s`, err)
+	}
+	builderImage, _, err := img.Append(builderImage, flattenTar)
+	if err != nil {
+		return nil, nil, fmt.Errorf(`failed append flattened layer to image: %s`, err)
+	}
+
+	builderImage, excludedTimestamps, err := f.appendLayeredBuildpacks(builderImage, dest, excluded)
+	if err != nil {
+		return nil, nil, err
+	}
+	return builderImage, append([]time.Time{timestamp}, excludedTimestamps...), nil
+}
+
+// partitionFlatten splits resolved into the buildpacks to merge into the flattened layer and the
+// buildpacks named in exclude, which keep their own layer.
+func partitionFlatten(resolved []resolvedBuildpack, exclude []string) (included, excluded []resolvedBuildpack) {
+	excludeSet := make(map[string]bool, len(exclude))
+	for _, id := range exclude {
+		excludeSet[id] = true
+	}
+	for _, bp := range resolved {
+		if excludeSet[bp.descriptor.ID] {
+			excluded = append(excluded, bp)
+		} else {
+			included = append(included, bp)
+		}
+	}
+	return included, excluded
+}
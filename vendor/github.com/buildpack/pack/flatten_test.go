@@ -0,0 +1,91 @@
+package pack
+
+import "testing"
+
+func bp(id string) resolvedBuildpack {
+	return resolvedBuildpack{descriptor: buildpackDescriptor{ID: id, Version: "1.0"}}
+}
+
+func ids(buildpacks []resolvedBuildpack) []string {
+	out := make([]string, len(buildpacks))
+	for i, bp := range buildpacks {
+		out[i] = bp.descriptor.ID
+	}
+	return out
+}
+
+func TestPartitionFlatten(t *testing.T) {
+	tests := []struct {
+		name         string
+		resolved     []resolvedBuildpack
+		exclude      []string
+		wantIncluded []string
+		wantExcluded []string
+	}{
+		{
+			name:         "no exclusions merges everything",
+			resolved:     []resolvedBuildpack{bp("a"), bp("b"), bp("c")},
+			exclude:      nil,
+			wantIncluded: []string{"a", "b", "c"},
+			wantExcluded: nil,
+		},
+		{
+			name:         "excluded buildpack kept out of the merged set",
+			resolved:     []resolvedBuildpack{bp("a"), bp("b"), bp("c")},
+			exclude:      []string{"b"},
+			wantIncluded: []string{"a", "c"},
+			wantExcluded: []string{"b"},
+		},
+		{
+			name:         "every buildpack excluded leaves nothing to merge",
+			resolved:     []resolvedBuildpack{bp("a"), bp("b")},
+			exclude:      []string{"a", "b"},
+			wantIncluded: nil,
+			wantExcluded: []string{"a", "b"},
+		},
+		{
+			name:         "excluding an id not present in resolved is a no-op",
+			resolved:     []resolvedBuildpack{bp("a")},
+			exclude:      []string{"does-not-exist"},
+			wantIncluded: []string{"a"},
+			wantExcluded: nil,
+		},
+		{
+			name:         "empty resolved",
+			resolved:     nil,
+			exclude:      []string{"a"},
+			wantIncluded: nil,
+			wantExcluded: nil,
+		},
+		{
+			name:         "preserves resolved order within each partition",
+			resolved:     []resolvedBuildpack{bp("a"), bp("b"), bp("c"), bp("d")},
+			exclude:      []string{"a", "c"},
+			wantIncluded: []string{"b", "d"},
+			wantExcluded: []string{"a", "c"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			included, excluded := partitionFlatten(tt.resolved, tt.exclude)
+			if gotIncluded := ids(included); !stringSlicesEqual(gotIncluded, tt.wantIncluded) {
+				t.Errorf("partitionFlatten() included = %v, want %v", gotIncluded, tt.wantIncluded)
+			}
+			if gotExcluded := ids(excluded); !stringSlicesEqual(gotExcluded, tt.wantExcluded) {
+				t.Errorf("partitionFlatten() excluded = %v, want %v", gotExcluded, tt.wantExcluded)
+			}
+		})
+	}
+}
+
+func stringSlicesEqual(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
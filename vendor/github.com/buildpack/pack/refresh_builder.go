@@ -0,0 +1,142 @@
+package pack
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"time"
+
+	"github.com/BurntSushi/toml"
+)
+
+// RefreshBuilderFlags configures BuilderFactory.Refresh, intended to be run on a cron alongside a
+// previously published builder image.
+type RefreshBuilderFlags struct {
+	RepoName        string
+	BuilderTomlPath string
+	StackID         string
+	// DryRun prints the reason a rebuild would happen, without building or pushing anything.
+	DryRun bool
+	// MaxAge forces a rebuild once the existing builder is older than this, regardless of whether
+	// any base image digest or buildpack source has changed.
+	MaxAge time.Duration
+}
+
+// Refresh rebuilds and pushes RepoName's builder image if the stack build image it was built from
+// has moved to a new digest, any local buildpack source is newer than the builder, or the builder is older
+// than MaxAge. Otherwise it logs "up to date" and returns nil.
+func (f *BuilderFactory) Refresh(flags RefreshBuilderFlags) error {
+	existing, err := f.Images.ReadImage(flags.RepoName, false)
+	if err != nil {
+		return fmt.Errorf(`failed to read existing builder image "%s": %s`, flags.RepoName, err)
+	}
+	if existing == nil {
+		return fmt.Errorf(`builder image "%s" was not found; run "create-builder" first`, flags.RepoName)
+	}
+	metadata, err := readBuilderMetadataLabel(existing)
+	if err != nil {
+		return fmt.Errorf(`failed to read builder metadata from "%s": %s`, flags.RepoName, err)
+	}
+
+	reason, err := f.refreshReason(flags, metadata)
+	if err != nil {
+		return err
+	}
+	if reason == "" {
+		f.Log.Println("up to date")
+		return nil
+	}
+
+	f.Log.Println("Rebuilding builder image:", reason)
+	if flags.DryRun {
+		return nil
+	}
+
+	// Rebuild with the same shape the builder was originally created with, so a cron-driven refresh
+	// doesn't silently drop a --target/--flatten/--output-timestamp the caller isn't repeating here.
+	config, err := f.BuilderConfigFromFlags(CreateBuilderFlags{
+		RepoName:        flags.RepoName,
+		BuilderTomlPath: flags.BuilderTomlPath,
+		StackID:         flags.StackID,
+		Publish:         true,
+		OutputTimestamp: metadata.OutputTimestamp,
+		Target:          metadata.Target,
+		Flatten:         metadata.Flatten,
+		FlattenExclude:  metadata.FlattenExclude,
+	})
+	if err != nil {
+		return err
+	}
+	return f.Create(config)
+}
+
+// refreshReason returns a human-readable reason a rebuild is needed, or "" if the builder is
+// up to date.
+func (f *BuilderFactory) refreshReason(flags RefreshBuilderFlags, metadata BuilderMetadata) (string, error) {
+	if flags.MaxAge > 0 {
+		if age := time.Since(metadata.BuiltAt); age > flags.MaxAge {
+			return fmt.Sprintf("builder is %s old, older than --max-age %s", age.Round(time.Second), flags.MaxAge), nil
+		}
+	}
+
+	stack, err := f.Config.Get(flags.StackID)
+	if err != nil {
+		return "", err
+	}
+	for _, buildImageRef := range stack.BuildImages {
+		if buildImageRef != metadata.BaseImageRef {
+			continue
+		}
+		image, err := f.Images.ReadImage(buildImageRef, false)
+		if err != nil {
+			return "", fmt.Errorf(`failed to read build image "%s": %s`, buildImageRef, err)
+		}
+		if image == nil {
+			continue
+		}
+		digest, err := image.Digest()
+		if err != nil {
+			return "", fmt.Errorf(`failed to read digest of build image "%s": %s`, buildImageRef, err)
+		}
+		if digest.String() != metadata.BaseImageDigest {
+			return fmt.Sprintf("base image %s moved to %s", buildImageRef, digest.String()), nil
+		}
+	}
+
+	newerBuildpack, err := f.buildpackSourceNewerThan(flags.BuilderTomlPath, metadata.BuiltAt)
+	if err != nil {
+		return "", err
+	}
+	if newerBuildpack != "" {
+		return fmt.Sprintf("buildpack %s source is newer than the builder", newerBuildpack), nil
+	}
+
+	return "", nil
+}
+
+// buildpackSourceNewerThan returns the ID of the first local (file:// or bare path) buildpack in builderTomlPath
+// whose source directory has been modified since since, or "" if none have.
+func (f *BuilderFactory) buildpackSourceNewerThan(builderTomlPath string, since time.Time) (string, error) {
+	var buildpackConfig struct {
+		Buildpacks []Buildpack `toml:"buildpacks"`
+	}
+	if _, err := toml.DecodeFile(builderTomlPath, &buildpackConfig); err != nil {
+		return "", fmt.Errorf(`failed to decode builder config from file "%s": %s`, builderTomlPath, err)
+	}
+	builderDir := filepath.Dir(builderTomlPath)
+
+	for _, buildpack := range buildpackConfig.Buildpacks {
+		if scheme := uriScheme(buildpack.URI); scheme != "" && scheme != "file" {
+			continue // only local sources have an mtime worth comparing
+		}
+		_, mtime, cleanup, err := (&fileDownloader{}).Download(context.Background(), buildpack.ID, buildpack.URI, builderDir)
+		if err != nil {
+			return "", err
+		}
+		cleanup()
+		if mtime.After(since) {
+			return buildpack.ID, nil
+		}
+	}
+	return "", nil
+}
@@ -0,0 +1,113 @@
+package pack
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// writeBuilderToml writes a minimal builder.toml declaring buildpacks (id, uri pairs) into dir and
+// returns its path.
+func writeBuilderToml(t *testing.T, dir string, buildpacks [][2]string) string {
+	t.Helper()
+	var out string
+	for _, bp := range buildpacks {
+		out += "[[buildpacks]]\n"
+		out += `id = "` + bp[0] + "\"\n"
+		out += `uri = "` + bp[1] + "\"\n\n"
+	}
+	path := filepath.Join(dir, "builder.toml")
+	if err := os.WriteFile(path, []byte(out), 0644); err != nil {
+		t.Fatalf("writing builder.toml: %s", err)
+	}
+	return path
+}
+
+func touch(t *testing.T, dir string, mtime time.Time) {
+	t.Helper()
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatalf("creating %s: %s", dir, err)
+	}
+	if err := os.Chtimes(dir, mtime, mtime); err != nil {
+		t.Fatalf("setting mtime of %s: %s", dir, err)
+	}
+}
+
+func TestBuildpackSourceNewerThan(t *testing.T) {
+	since := time.Unix(1000, 0)
+
+	t.Run("no local buildpacks are newer", func(t *testing.T) {
+		dir := t.TempDir()
+		touch(t, filepath.Join(dir, "bp-a"), since.Add(-time.Hour))
+		builderToml := writeBuilderToml(t, dir, [][2]string{{"a", "./bp-a"}})
+
+		f := &BuilderFactory{}
+		got, err := f.buildpackSourceNewerThan(builderToml, since)
+		if err != nil {
+			t.Fatalf("buildpackSourceNewerThan returned unexpected error: %s", err)
+		}
+		if got != "" {
+			t.Errorf("buildpackSourceNewerThan = %q, want \"\"", got)
+		}
+	})
+
+	t.Run("a local buildpack modified after since is reported", func(t *testing.T) {
+		dir := t.TempDir()
+		touch(t, filepath.Join(dir, "bp-a"), since.Add(-time.Hour))
+		touch(t, filepath.Join(dir, "bp-b"), since.Add(time.Hour))
+		builderToml := writeBuilderToml(t, dir, [][2]string{
+			{"a", "./bp-a"},
+			{"b", "./bp-b"},
+		})
+
+		f := &BuilderFactory{}
+		got, err := f.buildpackSourceNewerThan(builderToml, since)
+		if err != nil {
+			t.Fatalf("buildpackSourceNewerThan returned unexpected error: %s", err)
+		}
+		if got != "b" {
+			t.Errorf("buildpackSourceNewerThan = %q, want %q", got, "b")
+		}
+	})
+
+	t.Run("non-local buildpacks are skipped, not stat'd", func(t *testing.T) {
+		dir := t.TempDir()
+		builderToml := writeBuilderToml(t, dir, [][2]string{
+			{"remote", "https://example.com/bp.tgz"},
+		})
+
+		f := &BuilderFactory{}
+		got, err := f.buildpackSourceNewerThan(builderToml, since)
+		if err != nil {
+			t.Fatalf("buildpackSourceNewerThan returned unexpected error: %s", err)
+		}
+		if got != "" {
+			t.Errorf("buildpackSourceNewerThan = %q, want \"\"", got)
+		}
+	})
+
+	t.Run("missing builder.toml is an error", func(t *testing.T) {
+		f := &BuilderFactory{}
+		if _, err := f.buildpackSourceNewerThan(filepath.Join(t.TempDir(), "missing.toml"), since); err == nil {
+			t.Fatal("buildpackSourceNewerThan with a missing builder.toml expected an error, got none")
+		}
+	})
+}
+
+func TestRefreshReasonMaxAgeTakesPrecedence(t *testing.T) {
+	// flags.MaxAge is checked, and can return a reason, before refreshReason ever consults
+	// f.Config/f.Images for a digest move or buildpack mtime, so an old-enough builder is flagged
+	// for rebuild purely on age regardless of everything else being nil/unchecked.
+	f := &BuilderFactory{}
+	metadata := BuilderMetadata{BuiltAt: time.Now().Add(-48 * time.Hour)}
+	flags := RefreshBuilderFlags{MaxAge: 24 * time.Hour}
+
+	reason, err := f.refreshReason(flags, metadata)
+	if err != nil {
+		t.Fatalf("refreshReason returned unexpected error: %s", err)
+	}
+	if reason == "" {
+		t.Fatal("refreshReason with a builder older than --max-age expected a rebuild reason, got none")
+	}
+}
@@ -0,0 +1,207 @@
+package pack
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"github.com/pkg/errors"
+)
+
+// Target describes a platform (and optionally a distribution) a buildpack supports, parsed from a
+// buildpack.toml [[targets]] array, or resolved from a builder's --target flag.
+type Target struct {
+	OS            string         `toml:"os"`
+	Arch          string         `toml:"arch"`
+	ArchVariant   string         `toml:"arch-variant"`
+	Distributions []Distribution `toml:"distributions"`
+}
+
+// Distribution identifies an OS distribution a Target's buildpack was built against, e.g.
+// {Name: "ubuntu", Version: "20.04"}.
+type Distribution struct {
+	Name    string `toml:"name"`
+	Version string `toml:"version"`
+}
+
+// targetsDoc is the shape of the targets.toml file written into a buildpack layer when the
+// buildpack advertises [[targets]].
+type targetsDoc struct {
+	Targets []Target `toml:"targets"`
+}
+
+// parseTargetFlag parses a --target flag value of the form "os/arch[/arch-variant][:distro-name@distro-version]",
+// e.g. "linux/arm/v6:ubuntu@20.04". An empty value yields the zero Target, matching any buildpack target.
+func parseTargetFlag(value string) (Target, error) {
+	if value == "" {
+		return Target{}, nil
+	}
+
+	platform, distro := value, ""
+	if i := strings.Index(value, ":"); i >= 0 {
+		platform, distro = value[:i], value[i+1:]
+	}
+
+	parts := strings.Split(platform, "/")
+	if len(parts) < 2 || len(parts) > 3 {
+		return Target{}, fmt.Errorf(`invalid target "%s": expected "os/arch[/arch-variant]"`, value)
+	}
+	target := Target{OS: parts[0], Arch: parts[1]}
+	if len(parts) == 3 {
+		target.ArchVariant = parts[2]
+	}
+
+	if distro != "" {
+		nameVersion := strings.SplitN(distro, "@", 2)
+		if len(nameVersion) != 2 {
+			return Target{}, fmt.Errorf(`invalid target distribution "%s": expected "name@version"`, distro)
+		}
+		target.Distributions = []Distribution{{Name: nameVersion[0], Version: nameVersion[1]}}
+	}
+	return target, nil
+}
+
+// formatTargetFlag renders target back into the "os/arch[/arch-variant][:distro-name@distro-version]"
+// form parseTargetFlag accepts, e.g. for re-deriving a builder's original --target flag from its
+// recorded BuilderMetadata. The zero Target renders as "".
+func formatTargetFlag(target Target) string {
+	if target.OS == "" && target.Arch == "" {
+		return ""
+	}
+	value := target.OS + "/" + target.Arch
+	if target.ArchVariant != "" {
+		value += "/" + target.ArchVariant
+	}
+	if len(target.Distributions) > 0 {
+		d := target.Distributions[0]
+		value += ":" + d.Name + "@" + d.Version
+	}
+	return value
+}
+
+// targetMatches reports whether a buildpack declaring declaredTargets should be included for
+// target. A buildpack that declares no targets is assumed compatible with every target, as is
+// every buildpack when target itself is the zero value (no --target flag was given).
+func targetMatches(target Target, declaredTargets []Target) bool {
+	if target.OS == "" && target.Arch == "" {
+		return true
+	}
+	if len(declaredTargets) == 0 {
+		return true
+	}
+	for _, declared := range declaredTargets {
+		if declared.OS != target.OS || declared.Arch != target.Arch {
+			continue
+		}
+		if target.ArchVariant != "" && declared.ArchVariant != "" && declared.ArchVariant != target.ArchVariant {
+			continue
+		}
+		if distributionMatches(target, declared) {
+			return true
+		}
+	}
+	return false
+}
+
+func distributionMatches(target, declared Target) bool {
+	if len(target.Distributions) == 0 || len(declared.Distributions) == 0 {
+		return true
+	}
+	for _, want := range target.Distributions {
+		for _, have := range declared.Distributions {
+			if have.Name == want.Name && (want.Version == "" || have.Version == want.Version) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// buildpackDescriptor is the subset of a buildpack.toml this package cares about.
+type buildpackDescriptor struct {
+	ID      string
+	Version string
+	Targets []Target
+}
+
+// readBuildpackDescriptor parses the buildpack.toml found in dir and validates it against buildpack.
+func readBuildpackDescriptor(buildpack Buildpack, dir string) (buildpackDescriptor, error) {
+	var data struct {
+		BP struct {
+			ID      string `toml:"id"`
+			Version string `toml:"version"`
+		} `toml:"buildpack"`
+		Targets []Target `toml:"targets"`
+	}
+	tomlPath := filepath.Join(dir, "buildpack.toml")
+	if _, err := toml.DecodeFile(tomlPath, &data); err != nil {
+		return buildpackDescriptor{}, errors.Wrapf(err, "reading buildpack.toml from buildpack: %s", tomlPath)
+	}
+	if buildpack.ID != data.BP.ID {
+		return buildpackDescriptor{}, fmt.Errorf("buildpack ids did not match: %s != %s", buildpack.ID, data.BP.ID)
+	}
+	if data.BP.Version == "" {
+		return buildpackDescriptor{}, fmt.Errorf("buildpack.toml must provide version: %s", tomlPath)
+	}
+	return buildpackDescriptor{ID: data.BP.ID, Version: data.BP.Version, Targets: data.Targets}, nil
+}
+
+// stageBuildpackWithTargets copies srcDir into a scratch directory under dest and writes a
+// targets.toml there alongside buildpack.toml, so the eventual layer tar carries both files.
+func stageBuildpackWithTargets(dest string, buildpack Buildpack, srcDir string, targets []Target) (string, error) {
+	stageDir := filepath.Join(dest, "stage", buildpack.ID)
+	if err := copyDir(srcDir, stageDir); err != nil {
+		return "", errors.Wrapf(err, "staging buildpack %s", buildpack.ID)
+	}
+
+	targetsFile, err := os.Create(filepath.Join(stageDir, "targets.toml"))
+	if err != nil {
+		return "", errors.Wrapf(err, "creating targets.toml for buildpack %s", buildpack.ID)
+	}
+	defer targetsFile.Close()
+	if err := toml.NewEncoder(targetsFile).Encode(targetsDoc{Targets: targets}); err != nil {
+		return "", errors.Wrapf(err, "writing targets.toml for buildpack %s", buildpack.ID)
+	}
+	return stageDir, nil
+}
+
+// copyDir recursively copies the contents of src into dst, creating dst if necessary.
+func copyDir(src, dst string) error {
+	return filepath.Walk(src, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dst, rel)
+		if info.IsDir() {
+			return os.MkdirAll(target, 0755)
+		}
+		return copyFile(path, target, info.Mode())
+	})
+}
+
+func copyFile(src, dst string, mode os.FileMode) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return err
+	}
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, mode)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	_, err = io.Copy(out, in)
+	return err
+}
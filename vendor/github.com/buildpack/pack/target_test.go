@@ -0,0 +1,258 @@
+package pack
+
+import "testing"
+
+func TestParseTargetFlag(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   string
+		want    Target
+		wantErr bool
+	}{
+		{name: "empty value matches any target", value: "", want: Target{}},
+		{
+			name:  "os and arch",
+			value: "linux/amd64",
+			want:  Target{OS: "linux", Arch: "amd64"},
+		},
+		{
+			name:  "os, arch, and arch-variant",
+			value: "linux/arm/v6",
+			want:  Target{OS: "linux", Arch: "arm", ArchVariant: "v6"},
+		},
+		{
+			name:  "with distribution",
+			value: "linux/arm/v6:ubuntu@20.04",
+			want: Target{
+				OS: "linux", Arch: "arm", ArchVariant: "v6",
+				Distributions: []Distribution{{Name: "ubuntu", Version: "20.04"}},
+			},
+		},
+		{
+			name:  "os and arch with distribution, no arch-variant",
+			value: "linux/amd64:bionic@18.04",
+			want: Target{
+				OS: "linux", Arch: "amd64",
+				Distributions: []Distribution{{Name: "bionic", Version: "18.04"}},
+			},
+		},
+		{name: "missing arch", value: "linux", wantErr: true},
+		{name: "too many platform segments", value: "linux/arm/v6/extra", wantErr: true},
+		{name: "distribution missing version", value: "linux/amd64:ubuntu", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseTargetFlag(tt.value)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("parseTargetFlag(%q) expected an error, got none", tt.value)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseTargetFlag(%q) returned unexpected error: %s", tt.value, err)
+			}
+			if !targetsEqual(got, tt.want) {
+				t.Errorf("parseTargetFlag(%q) = %+v, want %+v", tt.value, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFormatTargetFlag(t *testing.T) {
+	tests := []struct {
+		name   string
+		target Target
+		want   string
+	}{
+		{name: "zero target", target: Target{}, want: ""},
+		{name: "os and arch", target: Target{OS: "linux", Arch: "amd64"}, want: "linux/amd64"},
+		{
+			name:   "with arch-variant",
+			target: Target{OS: "linux", Arch: "arm", ArchVariant: "v6"},
+			want:   "linux/arm/v6",
+		},
+		{
+			name: "with distribution",
+			target: Target{
+				OS: "linux", Arch: "arm", ArchVariant: "v6",
+				Distributions: []Distribution{{Name: "ubuntu", Version: "20.04"}},
+			},
+			want: "linux/arm/v6:ubuntu@20.04",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := formatTargetFlag(tt.target); got != tt.want {
+				t.Errorf("formatTargetFlag(%+v) = %q, want %q", tt.target, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseTargetFlagFormatTargetFlagRoundTrip(t *testing.T) {
+	values := []string{"", "linux/amd64", "linux/arm/v6", "linux/arm/v6:ubuntu@20.04"}
+	for _, value := range values {
+		target, err := parseTargetFlag(value)
+		if err != nil {
+			t.Fatalf("parseTargetFlag(%q) returned unexpected error: %s", value, err)
+		}
+		if got := formatTargetFlag(target); got != value {
+			t.Errorf("formatTargetFlag(parseTargetFlag(%q)) = %q, want %q", value, got, value)
+		}
+	}
+}
+
+func TestTargetMatches(t *testing.T) {
+	tests := []struct {
+		name            string
+		target          Target
+		declaredTargets []Target
+		want            bool
+	}{
+		{
+			name:            "no --target flag matches everything",
+			target:          Target{},
+			declaredTargets: []Target{{OS: "linux", Arch: "arm"}},
+			want:            true,
+		},
+		{
+			name:            "buildpack declares no targets, matches everything",
+			target:          Target{OS: "linux", Arch: "amd64"},
+			declaredTargets: nil,
+			want:            true,
+		},
+		{
+			name:            "matching os and arch",
+			target:          Target{OS: "linux", Arch: "amd64"},
+			declaredTargets: []Target{{OS: "linux", Arch: "amd64"}},
+			want:            true,
+		},
+		{
+			name:            "mismatched arch",
+			target:          Target{OS: "linux", Arch: "amd64"},
+			declaredTargets: []Target{{OS: "linux", Arch: "arm"}},
+			want:            false,
+		},
+		{
+			name:            "matching arch-variant",
+			target:          Target{OS: "linux", Arch: "arm", ArchVariant: "v6"},
+			declaredTargets: []Target{{OS: "linux", Arch: "arm", ArchVariant: "v6"}},
+			want:            true,
+		},
+		{
+			name:            "mismatched arch-variant",
+			target:          Target{OS: "linux", Arch: "arm", ArchVariant: "v6"},
+			declaredTargets: []Target{{OS: "linux", Arch: "arm", ArchVariant: "v7"}},
+			want:            false,
+		},
+		{
+			name:            "declared target has no arch-variant, matches any requested variant",
+			target:          Target{OS: "linux", Arch: "arm", ArchVariant: "v6"},
+			declaredTargets: []Target{{OS: "linux", Arch: "arm"}},
+			want:            true,
+		},
+		{
+			name:   "matching distribution",
+			target: Target{OS: "linux", Arch: "amd64", Distributions: []Distribution{{Name: "ubuntu", Version: "20.04"}}},
+			declaredTargets: []Target{
+				{OS: "linux", Arch: "amd64", Distributions: []Distribution{{Name: "ubuntu", Version: "20.04"}}},
+			},
+			want: true,
+		},
+		{
+			name:   "mismatched distribution",
+			target: Target{OS: "linux", Arch: "amd64", Distributions: []Distribution{{Name: "ubuntu", Version: "20.04"}}},
+			declaredTargets: []Target{
+				{OS: "linux", Arch: "amd64", Distributions: []Distribution{{Name: "bionic", Version: "18.04"}}},
+			},
+			want: false,
+		},
+		{
+			name:   "one of several declared targets matches",
+			target: Target{OS: "linux", Arch: "arm"},
+			declaredTargets: []Target{
+				{OS: "linux", Arch: "amd64"},
+				{OS: "linux", Arch: "arm"},
+			},
+			want: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := targetMatches(tt.target, tt.declaredTargets); got != tt.want {
+				t.Errorf("targetMatches(%+v, %+v) = %v, want %v", tt.target, tt.declaredTargets, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDistributionMatches(t *testing.T) {
+	tests := []struct {
+		name     string
+		target   Target
+		declared Target
+		want     bool
+	}{
+		{
+			name:     "target has no distributions, matches anything",
+			target:   Target{},
+			declared: Target{Distributions: []Distribution{{Name: "ubuntu", Version: "20.04"}}},
+			want:     true,
+		},
+		{
+			name:     "declared has no distributions, matches anything",
+			target:   Target{Distributions: []Distribution{{Name: "ubuntu", Version: "20.04"}}},
+			declared: Target{},
+			want:     true,
+		},
+		{
+			name:     "matching name, version unspecified on target",
+			target:   Target{Distributions: []Distribution{{Name: "ubuntu"}}},
+			declared: Target{Distributions: []Distribution{{Name: "ubuntu", Version: "20.04"}}},
+			want:     true,
+		},
+		{
+			name:     "matching name and version",
+			target:   Target{Distributions: []Distribution{{Name: "ubuntu", Version: "20.04"}}},
+			declared: Target{Distributions: []Distribution{{Name: "ubuntu", Version: "20.04"}}},
+			want:     true,
+		},
+		{
+			name:     "matching name, mismatched version",
+			target:   Target{Distributions: []Distribution{{Name: "ubuntu", Version: "20.04"}}},
+			declared: Target{Distributions: []Distribution{{Name: "ubuntu", Version: "18.04"}}},
+			want:     false,
+		},
+		{
+			name:     "mismatched name",
+			target:   Target{Distributions: []Distribution{{Name: "ubuntu", Version: "20.04"}}},
+			declared: Target{Distributions: []Distribution{{Name: "bionic", Version: "20.04"}}},
+			want:     false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := distributionMatches(tt.target, tt.declared); got != tt.want {
+				t.Errorf("distributionMatches(%+v, %+v) = %v, want %v", tt.target, tt.declared, got, tt.want)
+			}
+		})
+	}
+}
+
+// targetsEqual compares two Targets field by field, since Target contains a slice and isn't
+// comparable with ==.
+func targetsEqual(a, b Target) bool {
+	if a.OS != b.OS || a.Arch != b.Arch || a.ArchVariant != b.ArchVariant {
+		return false
+	}
+	if len(a.Distributions) != len(b.Distributions) {
+		return false
+	}
+	for i := range a.Distributions {
+		if a.Distributions[i] != b.Distributions[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,124 @@
+package pack
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/go-containerregistry/pkg/v1"
+)
+
+func TestResolveOutputTimestamp(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   string
+		want    time.Time
+		wantErr bool
+	}{
+		{name: "empty value defaults to build timestamp", value: ""},
+		{name: "explicit build timestamp", value: OutputTimestampBuildTimestamp},
+		{name: "zero", value: OutputTimestampZero, want: time.Unix(0, 0).UTC()},
+		{name: "unsupported value", value: "Bogus", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := resolveOutputTimestamp(tt.value, ".")
+			if tt.wantErr {
+				if err != ErrOutputTimestampValueNotSupported {
+					t.Fatalf("resolveOutputTimestamp(%q) error = %v, want ErrOutputTimestampValueNotSupported", tt.value, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("resolveOutputTimestamp(%q) returned unexpected error: %s", tt.value, err)
+			}
+			// "" and BuildTimestamp resolve to roughly now; Zero resolves to an exact, fixed value.
+			if !tt.want.IsZero() && !got.Equal(tt.want) {
+				t.Errorf("resolveOutputTimestamp(%q) = %v, want %v", tt.value, got, tt.want)
+			}
+			if tt.want.IsZero() && time.Since(got) > time.Minute {
+				t.Errorf("resolveOutputTimestamp(%q) = %v, want roughly now", tt.value, got)
+			}
+		})
+	}
+}
+
+func TestResolveOutputTimestampSourceTimestampUsesBuilderDir(t *testing.T) {
+	dir := t.TempDir()
+	got, err := resolveOutputTimestamp(OutputTimestampSourceTimestamp, dir)
+	if err != nil {
+		t.Fatalf("resolveOutputTimestamp(SourceTimestamp, %q) returned unexpected error: %s", dir, err)
+	}
+	want, err := sourceTimestamp(dir)
+	if err != nil {
+		t.Fatalf("sourceTimestamp(%q) returned unexpected error: %s", dir, err)
+	}
+	if !got.Equal(want) {
+		t.Errorf("resolveOutputTimestamp(SourceTimestamp, %q) = %v, want %v", dir, got, want)
+	}
+}
+
+// configFileImage is a fakeImage that also carries an explicit ConfigFile (including History), for
+// exercising setImageTimestamps without needing the rest of a real v1.Image.
+type configFileImage struct {
+	fakeImage
+	configFile *v1.ConfigFile
+}
+
+func (i *configFileImage) ConfigFile() (*v1.ConfigFile, error) {
+	return i.configFile, nil
+}
+
+func (i *configFileImage) Manifest() (*v1.Manifest, error) {
+	layers := make([]v1.Descriptor, len(i.configFile.History))
+	return &v1.Manifest{Layers: layers}, nil
+}
+
+func TestSetImageTimestampsRejectsShortHistory(t *testing.T) {
+	image := &configFileImage{configFile: &v1.ConfigFile{
+		History: []v1.History{{}, {}},
+	}}
+	layerTimestamps := []time.Time{time.Unix(1, 0), time.Unix(2, 0), time.Unix(3, 0)}
+
+	_, err := setImageTimestamps(image, time.Unix(0, 0), layerTimestamps)
+	if err == nil {
+		t.Fatal("setImageTimestamps with more layerTimestamps than history entries expected an error, got none")
+	}
+}
+
+func TestSetImageTimestampsAcceptsExactHistoryLength(t *testing.T) {
+	image := &configFileImage{configFile: &v1.ConfigFile{
+		History: []v1.History{{}, {}},
+	}}
+	layerTimestamps := []time.Time{time.Unix(1, 0), time.Unix(2, 0)}
+
+	if _, err := setImageTimestamps(image, time.Unix(0, 0), layerTimestamps); err != nil {
+		t.Fatalf("setImageTimestamps with exactly as many layerTimestamps as history entries returned unexpected error: %s", err)
+	}
+}
+
+func TestSetImageTimestampsLeavesBaseImageHistoryUntouched(t *testing.T) {
+	baseTime := time.Unix(100, 0)
+	image := &configFileImage{configFile: &v1.ConfigFile{
+		History: []v1.History{
+			{Created: v1.Time{Time: baseTime}}, // base image layer, predates Create's appends
+			{},                                 // order.toml layer, appended by Create
+			{},                                 // buildpack layer, appended by Create
+		},
+	}}
+	layerTimestamps := []time.Time{time.Unix(1, 0), time.Unix(2, 0)}
+
+	got, err := setImageTimestamps(image, time.Unix(0, 0), layerTimestamps)
+	if err != nil {
+		t.Fatalf("setImageTimestamps returned unexpected error: %s", err)
+	}
+	configFile, err := got.ConfigFile()
+	if err != nil {
+		t.Fatalf("ConfigFile() returned unexpected error: %s", err)
+	}
+	if !configFile.History[0].Created.Time.Equal(baseTime) {
+		t.Errorf("base image history entry Created = %v, want untouched %v", configFile.History[0].Created.Time, baseTime)
+	}
+	if !configFile.History[1].Created.Time.Equal(layerTimestamps[0]) || !configFile.History[2].Created.Time.Equal(layerTimestamps[1]) {
+		t.Errorf("appended history entries = %+v, want Created stamped from %v", configFile.History[1:], layerTimestamps)
+	}
+}